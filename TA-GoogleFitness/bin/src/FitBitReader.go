@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const fitbitActivitySummaryURL = "https://api.fitbit.com/1/user/-/activities/date/%s.json"
+
+// FitBitReader pulls daily activity summaries from the FitBit Web API for
+// each day between startTime and endTime.
+type FitBitReader struct {
+	startTime time.Time
+	endTime   time.Time
+}
+
+type fitbitActivitySummary struct {
+	Summary struct {
+		Steps int64 `json:"steps"`
+	} `json:"summary"`
+}
+
+// getData requests one activity summary per day in the reader's window,
+// emits a fitnessEvent per day, and returns endTime as the next checkpoint,
+// or startTime if any day's request failed.
+func (reader *FitBitReader) getData(ctx context.Context, client *http.Client, writer *syncWriter) time.Time {
+	ctx, span := tracer.Start(ctx, "FitBitReader.getData")
+	defer span.End()
+
+	failed := false
+
+	for day := reader.startTime; !day.After(reader.endTime); day = day.AddDate(0, 0, 1) {
+		url := fmt.Sprintf(fitbitActivitySummaryURL, day.Format("2006-01-02"))
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			log.Printf("Unable to build FitBit request: %v\n", err)
+			failed = true
+			continue
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("Unable to retrieve data from FitBit: %v\n", err)
+			failed = true
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("FitBit request for %s failed with status %s\n", day.Format("2006-01-02"), resp.Status)
+			resp.Body.Close()
+			failed = true
+			continue
+		}
+
+		var summary fitbitActivitySummary
+		err = json.NewDecoder(resp.Body).Decode(&summary)
+		resp.Body.Close()
+		if err != nil {
+			log.Printf("Unable to decode FitBit response: %v\n", err)
+			failed = true
+			continue
+		}
+
+		event := fitnessEvent{
+			Time:     day.Unix(),
+			Strategy: STRATEGY_FITBIT,
+			DataType: "steps",
+			Value:    float64(summary.Summary.Steps),
+		}
+		if err := writer.writeEvent(event); err != nil {
+			log.Printf("Unable to write FitBit event: %v\n", err)
+		}
+	}
+
+	// A failed day means this window wasn't fully processed; leave the
+	// checkpoint where it was so the whole window is retried next run
+	// instead of being marked done.
+	if failed {
+		return reader.startTime
+	}
+	return reader.endTime
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFitBitReaderGetData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"summary":{"steps":1234}}`))
+	}))
+	defer server.Close()
+
+	day := time.Now().Add(-24 * time.Hour)
+	reader := &FitBitReader{startTime: day, endTime: day}
+
+	var buf bytes.Buffer
+	writer := newSyncWriter(&buf)
+	client := &http.Client{Transport: redirectTransport{server.URL}}
+
+	checkpoint := reader.getData(context.Background(), client, writer)
+	if !checkpoint.Equal(reader.endTime) {
+		t.Errorf("expected checkpoint %v, got %v", reader.endTime, checkpoint)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"value":1234`)) {
+		t.Errorf("expected emitted event to contain steps value, got %q", buf.String())
+	}
+}
+
+func TestFitBitReaderGetDataNonOKStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"errors":[{"errorType":"rate_limit","message":"Too Many Requests"}]}`))
+	}))
+	defer server.Close()
+
+	day := time.Now().Add(-24 * time.Hour)
+	reader := &FitBitReader{startTime: day, endTime: day}
+
+	var buf bytes.Buffer
+	writer := newSyncWriter(&buf)
+	client := &http.Client{Transport: redirectTransport{server.URL}}
+
+	checkpoint := reader.getData(context.Background(), client, writer)
+	if !checkpoint.Equal(reader.startTime) {
+		t.Errorf("expected checkpoint to stay at %v on a non-OK response, got %v", reader.startTime, checkpoint)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no event to be emitted on a non-OK response, got %q", buf.String())
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
@@ -11,10 +13,12 @@ import (
 	"log"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/AndyNortrup/GoSplunk"
 )
@@ -25,6 +29,10 @@ const STRATEGY_FITBIT string = "FitBit"
 const STRATEGY_MICROSOFT string = "Microsoft"
 const STRATEGY_PARAM_NAME string = "FitnessService"
 const ENFORCE_CERT_VALIDATION string = "force_cert_validation"
+const MAX_PARALLEL_PARAM_NAME string = "max_parallel_fetches"
+const DEFAULT_MAX_PARALLEL_FETCHES int = 4
+const OTEL_ENDPOINT_PARAM_NAME string = "otel_endpoint"
+const METRICS_PORT_PARAM_NAME string = "metrics_port"
 
 type FitnessInput struct {
 	*splunk.ModInputConfig
@@ -45,6 +53,30 @@ func (input *FitnessInput) ReturnScheme() {
 			Title:       "FitnessService",
 			Description: "Enter the name of the Fitness Service to be polled.  Options are: 'GoogleFitness', 'FitBit', 'Microsoft'",
 			DataType:    "string",
+		},
+		splunk.Argument{
+			Name:        MAX_PARALLEL_PARAM_NAME,
+			Title:       "MaxParallelFetches",
+			Description: "Maximum number of user tokens to fetch data for concurrently. Defaults to 4.",
+			DataType:    "number",
+		},
+		splunk.Argument{
+			Name:        OTEL_ENDPOINT_PARAM_NAME,
+			Title:       "OTelEndpoint",
+			Description: "OTLP gRPC endpoint (host:port) to export fetch pipeline traces to. Leave blank to disable tracing.",
+			DataType:    "string",
+		},
+		splunk.Argument{
+			Name:        METRICS_PORT_PARAM_NAME,
+			Title:       "MetricsPort",
+			Description: "Port to expose Prometheus fitness_* metrics on at /metrics. Leave blank to disable the metrics server.",
+			DataType:    "number",
+		},
+		splunk.Argument{
+			Name:        CREDENTIALS_SOURCE_PARAM_NAME,
+			Title:       "CredentialsSource",
+			Description: "Where to load this strategy's OAuth2 client id/secret from: a path to a client_secret.json, inline JSON in that shape, or a storage/passwords entry ID. Leave blank to use the legacy Google-only storage/passwords lookup.",
+			DataType:    "string",
 		})
 
 	scheme := &splunk.Scheme{
@@ -91,38 +123,145 @@ func (input *FitnessInput) StreamEvents() {
 	}
 	input.ModInputConfig = config
 
-	//TODO: Replace hard coded values with pull from storage/passwords
-	// tok := newToken("1/7u5ngLKEF2MiVYHvnWwYKRIb8s3s8u2e8JtHZ2yjUAQ",
-	// 	"ya29.Ci8IA_du7mknNus-G_UTfiWB3FHeqdpIqEj_bwaUSvB2lYvsZSuKB7E-2TVuDM44sw",
-	// 	"2016-06-21 07:59:23.44961918 -0700 PDT",
-	// 	"Bearer")
+	shutdownTracing := initTracing(input.getOtelEndpoint())
+	defer shutdownTracing(context.Background())
+	startMetricsServer(input.getMetricsPort())
+
+	rootCtx, rootSpan := tracer.Start(context.Background(), "StreamEvents")
+	defer rootSpan.End()
 
 	tokens := input.getTokens()
+	strategy := input.getStrategy()
+	clientId, clientSecret, scopes := input.loadCredentials(strategy, input.getCredentialsSource())
+	out := newSyncWriter(os.Stdout)
+
+	group, ctx := errgroup.WithContext(rootCtx)
+	sem := make(chan struct{}, input.getMaxParallelFetches())
+
+	for _, entry := range tokens {
+		entry := entry
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		group.Go(func() error {
+			defer func() { <-sem }()
+			return input.processToken(ctx, entry, strategy, clientId, clientSecret, scopes, out)
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		log.Printf("Error while streaming fitness events: %v\n", err)
+	}
+}
+
+// processToken fetches and streams fitness data for a single user's token.
+// It checkpoints independently of any other token being processed
+// concurrently for the same strategy, so one user's progress can never
+// overwrite another's.
+func (input *FitnessInput) processToken(ctx context.Context, entry tokenEntry, strategy string, clientId string, clientSecret string, scopes []string, out *syncWriter) error {
+	ctx, span := tracer.Start(ctx, "processToken")
+	defer span.End()
+
+	start := time.Now()
+	defer func() {
+		fetchDuration.WithLabelValues(strategy).Observe(time.Since(start).Seconds())
+	}()
+
+	client := getClient(strategy, entry.token, clientId, clientSecret, scopes, func(old *oauth2.Token, refreshed *oauth2.Token) {
+		persistRefreshedToken(input.SessionKey, strategy, entry.username, old, refreshed)
+	})
+
+	//Get start and end points from checkpoint
+	startTime, endTime := input.getTimes(strategy, entry.username)
+
+	//Create a Fitness Reader to go get the data
+	fitnessReader, err := input.getReaderStrategy(ctx, startTime, endTime)
+	if err != nil {
+		return err
+	}
+
+	checkpoint := fitnessReader.getData(ctx, client, out)
+	if err := input.writeCheckPoint(checkpoint, strategy, entry.username); err != nil {
+		return err
+	}
+
+	checkpointLag.WithLabelValues(input.Stanzas[0].StanzaName).Set(time.Since(checkpoint).Seconds())
+	return nil
+}
 
-	for _, token := range tokens {
-		//Create HTTP client
-		clientId, clientSecret := input.getAppCredentials()
-		client := getClient(token, clientId, clientSecret)
+// getMaxParallelFetches returns the admin-configured bound on how many
+// tokens are fetched concurrently, or DEFAULT_MAX_PARALLEL_FETCHES if unset.
+func (input *FitnessInput) getMaxParallelFetches() int {
+	for _, stanza := range input.Stanzas {
+		for _, param := range stanza.Params {
+			if param.Name == MAX_PARALLEL_PARAM_NAME {
+				if n, err := strconv.Atoi(param.Value); err == nil && n > 0 {
+					return n
+				}
+			}
+		}
+	}
+	return DEFAULT_MAX_PARALLEL_FETCHES
+}
 
-		//Get start and end points from checkpoint
-		startTime, endTime := input.getTimes()
+// getCredentialsSource returns the admin-configured credentials_source for
+// this stanza, or "" if unset.
+func (input *FitnessInput) getCredentialsSource() string {
+	for _, stanza := range input.Stanzas {
+		for _, param := range stanza.Params {
+			if param.Name == CREDENTIALS_SOURCE_PARAM_NAME {
+				return param.Value
+			}
+		}
+	}
+	return ""
+}
 
-		//Create a Fitness Reader to go get the data
-		fitnessReader, err := input.getReaderStrategy(startTime, endTime)
-		if err != nil {
-			log.Fatal(err)
+// getOtelEndpoint returns the admin-configured OTLP collector endpoint, or
+// "" if tracing hasn't been configured for this stanza.
+func (input *FitnessInput) getOtelEndpoint() string {
+	for _, stanza := range input.Stanzas {
+		for _, param := range stanza.Params {
+			if param.Name == OTEL_ENDPOINT_PARAM_NAME {
+				return param.Value
+			}
 		}
+	}
+	return ""
+}
 
-		input.writeCheckPoint(fitnessReader.getData(client, bufio.NewWriter(os.Stdout)))
+// getMetricsPort returns the admin-configured port to serve Prometheus
+// metrics on, or "" if the metrics server hasn't been enabled.
+func (input *FitnessInput) getMetricsPort() string {
+	for _, stanza := range input.Stanzas {
+		for _, param := range stanza.Params {
+			if param.Name == METRICS_PORT_PARAM_NAME {
+				return param.Value
+			}
+		}
 	}
+	return ""
 }
 
-func (input *FitnessInput) getReaderStrategy(startTime time.Time, endTime time.Time) (FitnessReader, error) {
+func (input *FitnessInput) getReaderStrategy(ctx context.Context, startTime time.Time, endTime time.Time) (FitnessReader, error) {
+	_, span := tracer.Start(ctx, "getReaderStrategy")
+	defer span.End()
+
 	strategy := input.getStrategy()
 	switch {
 	case strategy == STRATEGY_GOOGLE:
 		reader := &GoogleFitnessReader{startTime: startTime, endTime: endTime}
 		return reader, nil
+	case strategy == STRATEGY_FITBIT:
+		reader := &FitBitReader{startTime: startTime, endTime: endTime}
+		return reader, nil
+	case strategy == STRATEGY_MICROSOFT:
+		reader := &MicrosoftReader{startTime: startTime, endTime: endTime}
+		return reader, nil
 	default:
 		return nil, errors.New("Unsupported reader requested: " + strategy)
 	}
@@ -182,9 +321,17 @@ func (input *FitnessInput) getAppCredentials() (string, string) {
 	return clientId, clientSecret
 }
 
+// tokenEntry pairs a token pulled from storage/passwords with the username
+// its entry was stored under, so a refreshed token can be written back to
+// the same entry it came from.
+type tokenEntry struct {
+	username string
+	token    *oauth2.Token
+}
+
 // getTokens gets a list of tokens that are in the storage/passwords endpoint
 // for the given strategy
-func (input *FitnessInput) getTokens() []*oauth2.Token {
+func (input *FitnessInput) getTokens() []tokenEntry {
 	entities, err := splunk.GetEntities(splunk.LocalSplunkMgmntURL,
 		[]string{"storage", "passwords"},
 		APP_NAME,
@@ -195,11 +342,12 @@ func (input *FitnessInput) getTokens() []*oauth2.Token {
 		log.Fatalf("Unable to get user tokens from Splunk: %v\n", err)
 	}
 
-	var result []*oauth2.Token
+	var result []tokenEntry
 
 	for _, entry := range entities.Entries {
 		isForStrategy := false
 		var tokenJSON string
+		var username string
 
 		// Itterate through all of the password entries
 		for _, key := range entry.Contents.Keys {
@@ -210,27 +358,23 @@ func (input *FitnessInput) getTokens() []*oauth2.Token {
 			//Determine if this key matches our strategy
 			case key.Name == "realm" && key.Value == input.getStrategy():
 				isForStrategy = true
-
+			case key.Name == "username":
+				username = key.Value
 			}
 		}
 
 		if isForStrategy {
 
-			//Temporary struct so we can get string values out then make a JSON token
-			// by properly converting the date stamp
-			type tokenData struct {
-				AccessToken  string `json:"access_token"`
-				RefreshToken string `json:"refresh_token"`
-				TokenType    string `json:"token_type"`
-				Expires      string `json:"expires_at"`
-			}
 			temp := &tokenData{}
 			decode := json.NewDecoder(strings.NewReader(tokenJSON))
 			err := decode.Decode(temp)
 			if err != nil {
 				log.Fatalf("Failed to decode passwords from storage/passwords: %v\n JSON to Decode: %v\n", err, tokenJSON)
 			}
-			result = append(result, newToken(temp.RefreshToken, temp.AccessToken, temp.Expires, temp.TokenType))
+			result = append(result, tokenEntry{
+				username: username,
+				token:    newToken(temp.RefreshToken, temp.AccessToken, temp.Expires, temp.TokenType),
+			})
 		}
 	}
 	return result
@@ -239,8 +383,8 @@ func (input *FitnessInput) getTokens() []*oauth2.Token {
 //getTimes returns a startTime and an endTime value.  endTime is retrived from
 // a checkpoint file, if not it returns the current time.
 // The end time is always the current time.
-func (input *FitnessInput) getTimes() (time.Time, time.Time) {
-	startTime, err := input.readCheckPoint()
+func (input *FitnessInput) getTimes(strategy string, username string) (time.Time, time.Time) {
+	startTime, err := input.readCheckPoint(strategy, username)
 	if err != nil {
 		startTime = time.Now()
 	}
@@ -248,23 +392,24 @@ func (input *FitnessInput) getTimes() (time.Time, time.Time) {
 	return startTime, endTime
 }
 
-func (input *FitnessInput) writeCheckPoint(t time.Time) {
+func (input *FitnessInput) writeCheckPoint(t time.Time, strategy string, username string) error {
 
 	//Encode the time we've been given into bytes
 	g, err := t.GobEncode()
 	if err != nil {
-		log.Fatalf("Unable to encode checkpoint time: %v\n", err)
+		return fmt.Errorf("unable to encode checkpoint time: %v", err)
 	}
 
 	//Write the checkpoint
-	err = ioutil.WriteFile(input.getCheckPointPath(), g, 0644)
+	err = ioutil.WriteFile(input.getCheckPointPath(strategy, username), g, 0644)
 	if err != nil {
-		log.Fatalf("Error writing checkpoint file: %v\n", err)
+		return fmt.Errorf("error writing checkpoint file: %v", err)
 	}
+	return nil
 }
 
-func (input *FitnessInput) readCheckPoint() (time.Time, error) {
-	b, err := ioutil.ReadFile(input.getCheckPointPath())
+func (input *FitnessInput) readCheckPoint(strategy string, username string) (time.Time, error) {
+	b, err := ioutil.ReadFile(input.getCheckPointPath(strategy, username))
 	if err != nil {
 		log.Printf("Unable to read checkpoint file:%v\n", err)
 		return time.Now(), err
@@ -278,11 +423,13 @@ func (input *FitnessInput) readCheckPoint() (time.Time, error) {
 	return t, nil
 }
 
-// Takes the checkpoint dir from and config stanza name from the input and
-// creates a checkpoint dir.  Should be unique for each input
-func (input *FitnessInput) getCheckPointPath() string {
-	//Create a hash of the stanza name as a filename
-	fileName := strings.Split(input.Stanzas[0].StanzaName, "://")
-	path := path.Join(input.CheckpointDir, fileName[1])
-	return path
+// getCheckPointPath returns a checkpoint file path unique to this stanza and
+// the (strategy, username) token it's being used for, so multiple users
+// configured under the same strategy each get their own checkpoint instead
+// of clobbering a single shared one.
+func (input *FitnessInput) getCheckPointPath(strategy string, username string) string {
+	h := sha1.New()
+	h.Write([]byte(strategy + "|" + username + "|" + input.Stanzas[0].StanzaName))
+	fileName := hex.EncodeToString(h.Sum(nil))
+	return path.Join(input.CheckpointDir, fileName)
 }
\ No newline at end of file
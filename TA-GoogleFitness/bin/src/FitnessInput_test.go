@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path"
+	"testing"
+
+	"github.com/AndyNortrup/GoSplunk"
+)
+
+func newTestInput(checkpointDir string, stanzaName string) *FitnessInput {
+	return &FitnessInput{
+		ModInputConfig: &splunk.ModInputConfig{
+			CheckpointDir: checkpointDir,
+			Stanzas:       []splunk.Stanza{{StanzaName: stanzaName}},
+		},
+	}
+}
+
+func TestGetCheckPointPath(t *testing.T) {
+	const checkpointDir = "/opt/splunk/var/lib/splunk/modinputs/checkpoints"
+
+	cases := []struct {
+		name     string
+		strategy string
+		username string
+		stanza   string
+	}{
+		{"google/alice on stanza1", STRATEGY_GOOGLE, "alice@example.com", "google_fitness://stanza1"},
+		{"fitbit/alice on stanza1", STRATEGY_FITBIT, "alice@example.com", "google_fitness://stanza1"},
+		{"fitbit/bob on stanza1", STRATEGY_FITBIT, "bob@example.com", "google_fitness://stanza1"},
+		{"fitbit/bob on stanza2", STRATEGY_FITBIT, "bob@example.com", "google_fitness://stanza2"},
+	}
+
+	seen := map[string]string{}
+	for _, c := range cases {
+		input := newTestInput(checkpointDir, c.stanza)
+		got := input.getCheckPointPath(c.strategy, c.username)
+
+		if dir, _ := path.Split(got); path.Clean(dir) != path.Clean(checkpointDir) {
+			t.Errorf("%s: expected path under %q, got %q", c.name, checkpointDir, got)
+		}
+
+		for otherName, otherPath := range seen {
+			if otherPath == got {
+				t.Errorf("%s: checkpoint path %q collides with %s", c.name, got, otherName)
+			}
+		}
+		seen[c.name] = got
+	}
+}
+
+func TestGetCheckPointPathIsStable(t *testing.T) {
+	input := newTestInput("/tmp/checkpoints", "google_fitness://stanza1")
+	first := input.getCheckPointPath(STRATEGY_GOOGLE, "alice@example.com")
+	second := input.getCheckPointPath(STRATEGY_GOOGLE, "alice@example.com")
+	if first != second {
+		t.Errorf("expected getCheckPointPath to be deterministic, got %q then %q", first, second)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FitnessReader is implemented by each supported fitness service.  getData
+// pulls the service's activity data for the reader's configured time window,
+// writes it to writer as Splunk events (one JSON object per line so it works
+// with the "simple" streaming mode declared in ReturnScheme), and returns the
+// time that should become the next run's checkpoint. ctx carries the
+// OpenTelemetry span for the fetch so implementations can propagate it onto
+// their HTTP requests.
+type FitnessReader interface {
+	getData(ctx context.Context, client *http.Client, writer *syncWriter) time.Time
+}
+
+// fitnessEvent is the common shape every strategy's getData emits so that
+// dashboards built against one provider work unmodified against the others.
+type fitnessEvent struct {
+	Time     int64   `json:"time"`
+	Strategy string  `json:"strategy"`
+	DataType string  `json:"data_type"`
+	Value    float64 `json:"value"`
+}
+
+// syncWriter guards a single bufio.Writer with a mutex so that readers
+// fetching different users' tokens concurrently can each write events to the
+// same underlying stream (stdout) without interleaving the bytes of two
+// events, which would corrupt Splunk's "simple" streaming mode.
+type syncWriter struct {
+	mu     sync.Mutex
+	writer *bufio.Writer
+}
+
+// newSyncWriter wraps w in a buffered writer guarded by a mutex.
+func newSyncWriter(w io.Writer) *syncWriter {
+	return &syncWriter{writer: bufio.NewWriter(w)}
+}
+
+// writeEvent serializes a single fitnessEvent as a line of JSON and flushes
+// it to the underlying writer, atomically with respect to any other
+// goroutine's writeEvent call, so Splunk always sees complete events even if
+// the process is killed mid-run.
+func (s *syncWriter) writeEvent(e fitnessEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.writer.Write(b); err != nil {
+		return err
+	}
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+
+	eventsEmitted.WithLabelValues(e.Strategy).Inc()
+	return nil
+}
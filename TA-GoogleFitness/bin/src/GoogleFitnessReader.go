@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const googleFitnessAggregateURL = "https://www.googleapis.com/fitness/v1/users/me/dataset:aggregate"
+
+// GoogleFitnessReader pulls step count data from the Google Fitness REST API
+// for the window between startTime and endTime.
+type GoogleFitnessReader struct {
+	startTime time.Time
+	endTime   time.Time
+}
+
+type googleAggregateRequest struct {
+	AggregateBy []struct {
+		DataTypeName string `json:"dataTypeName"`
+	} `json:"aggregateBy"`
+	BucketByTime struct {
+		DurationMillis int64 `json:"durationMillis"`
+	} `json:"bucketByTime"`
+	StartTimeMillis int64 `json:"startTimeMillis"`
+	EndTimeMillis   int64 `json:"endTimeMillis"`
+}
+
+type googleAggregateResponse struct {
+	Bucket []struct {
+		StartTimeMillis string `json:"startTimeMillis"`
+		Dataset         []struct {
+			Point []struct {
+				Value []struct {
+					IntVal int64 `json:"intVal"`
+				} `json:"value"`
+			} `json:"point"`
+		} `json:"dataset"`
+	} `json:"bucket"`
+}
+
+// getData requests an aggregated step count bucketed by day, emits one
+// fitnessEvent per bucket, and returns endTime as the next checkpoint, or
+// startTime if the API answers with a non-OK status.
+func (reader *GoogleFitnessReader) getData(ctx context.Context, client *http.Client, writer *syncWriter) time.Time {
+	ctx, span := tracer.Start(ctx, "GoogleFitnessReader.getData")
+	defer span.End()
+
+	reqBody := googleAggregateRequest{
+		StartTimeMillis: reader.startTime.UnixNano() / int64(time.Millisecond),
+		EndTimeMillis:   reader.endTime.UnixNano() / int64(time.Millisecond),
+	}
+	reqBody.AggregateBy = append(reqBody.AggregateBy, struct {
+		DataTypeName string `json:"dataTypeName"`
+	}{DataTypeName: "com.google.step_count.delta"})
+	reqBody.BucketByTime.DurationMillis = int64(24 * time.Hour / time.Millisecond)
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		log.Printf("Unable to marshal Google Fitness aggregate request: %v\n", err)
+		return reader.endTime
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googleFitnessAggregateURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Unable to build Google Fitness request: %v\n", err)
+		return reader.endTime
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Unable to retrieve data from Google Fitness: %v\n", err)
+		return reader.endTime
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Google Fitness request failed with status %s; leaving checkpoint at %v\n", resp.Status, reader.startTime)
+		return reader.startTime
+	}
+
+	var aggregate googleAggregateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&aggregate); err != nil {
+		log.Printf("Unable to decode Google Fitness response: %v\n", err)
+		return reader.endTime
+	}
+
+	for _, bucket := range aggregate.Bucket {
+		var steps int64
+		for _, dataset := range bucket.Dataset {
+			for _, point := range dataset.Point {
+				for _, value := range point.Value {
+					steps += value.IntVal
+				}
+			}
+		}
+
+		bucketTime, err := parseMillis(bucket.StartTimeMillis)
+		if err != nil {
+			log.Printf("Unable to parse Google Fitness bucket time %q: %v\n", bucket.StartTimeMillis, err)
+			continue
+		}
+
+		event := fitnessEvent{
+			Time:     bucketTime.Unix(),
+			Strategy: STRATEGY_GOOGLE,
+			DataType: "steps",
+			Value:    float64(steps),
+		}
+		if err := writer.writeEvent(event); err != nil {
+			log.Printf("Unable to write Google Fitness event: %v\n", err)
+		}
+	}
+
+	return reader.endTime
+}
+
+// parseMillis converts a string of Unix milliseconds, as returned in
+// Google's bucket.startTimeMillis field, into a time.Time.
+func parseMillis(millis string) (time.Time, error) {
+	var ms int64
+	if _, err := fmt.Sscanf(millis, "%d", &ms); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGoogleFitnessReaderGetData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"bucket":[{"startTimeMillis":"1000000","dataset":[{"point":[{"value":[{"intVal":42}]}]}]}]}`))
+	}))
+	defer server.Close()
+
+	reader := &GoogleFitnessReader{
+		startTime: time.Now().Add(-24 * time.Hour),
+		endTime:   time.Now(),
+	}
+
+	var buf bytes.Buffer
+	writer := newSyncWriter(&buf)
+	client := &http.Client{Transport: redirectTransport{server.URL}}
+
+	checkpoint := reader.getData(context.Background(), client, writer)
+	if !checkpoint.Equal(reader.endTime) {
+		t.Errorf("expected checkpoint %v, got %v", reader.endTime, checkpoint)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"value":42`)) {
+		t.Errorf("expected emitted event to contain steps value, got %q", buf.String())
+	}
+}
+
+func TestGoogleFitnessReaderGetDataNonOKStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"code":429,"message":"Rate Limit Exceeded"}}`))
+	}))
+	defer server.Close()
+
+	reader := &GoogleFitnessReader{
+		startTime: time.Now().Add(-24 * time.Hour),
+		endTime:   time.Now(),
+	}
+
+	var buf bytes.Buffer
+	writer := newSyncWriter(&buf)
+	client := &http.Client{Transport: redirectTransport{server.URL}}
+
+	checkpoint := reader.getData(context.Background(), client, writer)
+	if !checkpoint.Equal(reader.startTime) {
+		t.Errorf("expected checkpoint to stay at %v on a non-OK response, got %v", reader.startTime, checkpoint)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no event to be emitted on a non-OK response, got %q", buf.String())
+	}
+}
+
+// redirectTransport sends every request to baseURL instead of its original
+// host so tests can point the reader at an httptest.Server.
+type redirectTransport struct {
+	baseURL string
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, err := http.NewRequest(req.Method, rt.baseURL, req.Body)
+	if err != nil {
+		return nil, err
+	}
+	target.Header = req.Header
+	return http.DefaultTransport.RoundTrip(target)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const microsoftActivitySummaryURL = "https://graph.microsoft.com/v1.0/me/activities/summaries?start=%s&end=%s"
+
+// MicrosoftReader pulls activity summaries from the Microsoft Graph health
+// APIs for the window between startTime and endTime.
+type MicrosoftReader struct {
+	startTime time.Time
+	endTime   time.Time
+}
+
+type microsoftActivitySummaryResponse struct {
+	Value []struct {
+		Date  string `json:"summaryDate"`
+		Steps int64  `json:"stepCount"`
+	} `json:"value"`
+}
+
+// getData requests activity summaries for the reader's window, emits a
+// fitnessEvent per day returned, and returns endTime as the next checkpoint,
+// or startTime if the API answers with a non-OK status.
+func (reader *MicrosoftReader) getData(ctx context.Context, client *http.Client, writer *syncWriter) time.Time {
+	ctx, span := tracer.Start(ctx, "MicrosoftReader.getData")
+	defer span.End()
+
+	url := fmt.Sprintf(microsoftActivitySummaryURL,
+		reader.startTime.Format("2006-01-02"),
+		reader.endTime.Format("2006-01-02"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		log.Printf("Unable to build Microsoft Graph request: %v\n", err)
+		return reader.endTime
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Unable to retrieve data from Microsoft Graph: %v\n", err)
+		return reader.endTime
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Microsoft Graph request failed with status %s; leaving checkpoint at %v\n", resp.Status, reader.startTime)
+		return reader.startTime
+	}
+
+	var summaries microsoftActivitySummaryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&summaries); err != nil {
+		log.Printf("Unable to decode Microsoft Graph response: %v\n", err)
+		return reader.endTime
+	}
+
+	for _, day := range summaries.Value {
+		dayTime, err := time.Parse("2006-01-02", day.Date)
+		if err != nil {
+			log.Printf("Unable to parse Microsoft Graph summary date %q: %v\n", day.Date, err)
+			continue
+		}
+
+		event := fitnessEvent{
+			Time:     dayTime.Unix(),
+			Strategy: STRATEGY_MICROSOFT,
+			DataType: "steps",
+			Value:    float64(day.Steps),
+		}
+		if err := writer.writeEvent(event); err != nil {
+			log.Printf("Unable to write Microsoft event: %v\n", err)
+		}
+	}
+
+	return reader.endTime
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMicrosoftReaderGetData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"value":[{"summaryDate":"2020-01-01","stepCount":5678}]}`))
+	}))
+	defer server.Close()
+
+	reader := &MicrosoftReader{
+		startTime: time.Now().Add(-24 * time.Hour),
+		endTime:   time.Now(),
+	}
+
+	var buf bytes.Buffer
+	writer := newSyncWriter(&buf)
+	client := &http.Client{Transport: redirectTransport{server.URL}}
+
+	checkpoint := reader.getData(context.Background(), client, writer)
+	if !checkpoint.Equal(reader.endTime) {
+		t.Errorf("expected checkpoint %v, got %v", reader.endTime, checkpoint)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"value":5678`)) {
+		t.Errorf("expected emitted event to contain steps value, got %q", buf.String())
+	}
+}
+
+func TestMicrosoftReaderGetDataNonOKStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"code":"InvalidAuthenticationToken","message":"Access token has expired"}}`))
+	}))
+	defer server.Close()
+
+	reader := &MicrosoftReader{
+		startTime: time.Now().Add(-24 * time.Hour),
+		endTime:   time.Now(),
+	}
+
+	var buf bytes.Buffer
+	writer := newSyncWriter(&buf)
+	client := &http.Client{Transport: redirectTransport{server.URL}}
+
+	checkpoint := reader.getData(context.Background(), client, writer)
+	if !checkpoint.Equal(reader.startTime) {
+		t.Errorf("expected checkpoint to stay at %v on a non-OK response, got %v", reader.startTime, checkpoint)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no event to be emitted on a non-OK response, got %q", buf.String())
+	}
+}
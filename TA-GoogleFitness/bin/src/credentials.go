@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/AndyNortrup/GoSplunk"
+)
+
+const CREDENTIALS_SOURCE_PARAM_NAME string = "credentials_source"
+
+// googleClientSecretFile is the shape of the client_secret.json the Google
+// Cloud console downloads. FitBit and Microsoft admins pointing
+// credentials_source at a file are asked to mimic the same "installed"/"web"
+// shape so one parser covers all three strategies.
+type googleClientSecretFile struct {
+	Installed *clientSecretDetails `json:"installed"`
+	Web       *clientSecretDetails `json:"web"`
+}
+
+type clientSecretDetails struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// loadCredentials resolves an admin-supplied credentials_source value into
+// the client id/secret/scopes getClient needs. source is auto-detected as
+// one of: a filesystem path to a client_secret.json, inline JSON in that
+// same shape, or a storage/passwords entry ID. An empty source falls back to
+// the original Google-only storage/passwords lookup so existing TA-
+// GoogleFitness deployments keep working unmodified.
+func (input *FitnessInput) loadCredentials(strategy string, source string) (string, string, []string) {
+	scopes := strategyScopes[strategy]
+
+	if source == "" {
+		clientId, clientSecret := input.getAppCredentials()
+		return clientId, clientSecret, scopes
+	}
+
+	if contents, err := ioutil.ReadFile(source); err == nil {
+		if clientId, clientSecret, ok := parseClientSecretJSON(contents); ok {
+			return clientId, clientSecret, scopes
+		}
+		log.Printf("credentials_source %q is a file but isn't a recognized client_secret.json\n", source)
+	}
+
+	if clientId, clientSecret, ok := parseClientSecretJSON([]byte(source)); ok {
+		return clientId, clientSecret, scopes
+	}
+
+	clientId, clientSecret := input.getCredentialsFromPasswords(source)
+	return clientId, clientSecret, scopes
+}
+
+// parseClientSecretJSON decodes a Google-style client_secret.json payload,
+// returning ok=false if b isn't valid JSON in that shape.
+func parseClientSecretJSON(b []byte) (clientId string, clientSecret string, ok bool) {
+	var file googleClientSecretFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return "", "", false
+	}
+	details := file.Installed
+	if details == nil {
+		details = file.Web
+	}
+	if details == nil || details.ClientID == "" {
+		return "", "", false
+	}
+	return details.ClientID, details.ClientSecret, true
+}
+
+// getCredentialsFromPasswords looks up a specific storage/passwords entry by
+// ID, mirroring getAppCredentials but for an admin-named reference instead
+// of the first Google-shaped entry found.
+func (input *FitnessInput) getCredentialsFromPasswords(entryID string) (string, string) {
+	passwords, err := splunk.GetEntities(splunk.LocalSplunkMgmntURL,
+		[]string{"storage", "passwords"},
+		APP_NAME,
+		"nobody",
+		input.SessionKey)
+	if err != nil {
+		log.Fatalf("Unable to retrieve password entries for TA-GoogleFitness: %v\n", err)
+	}
+
+	for _, entry := range passwords.Entries {
+		if !strings.Contains(entry.ID, entryID) {
+			continue
+		}
+
+		var clientId, clientSecret string
+		for _, key := range entry.Contents.Keys {
+			if key.Name == "clear_password" {
+				clientSecret = key.Value
+			}
+			if key.Name == "username" {
+				clientId = key.Value
+			}
+		}
+		return clientId, clientSecret
+	}
+
+	log.Fatalf("No storage/passwords entry found for credentials_source %q\n", entryID)
+	return "", ""
+}
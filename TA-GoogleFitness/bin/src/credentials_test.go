@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseClientSecretJSON(t *testing.T) {
+	cases := []struct {
+		name             string
+		body             string
+		wantClientId     string
+		wantClientSecret string
+		wantOk           bool
+	}{
+		{
+			name:             "installed shape",
+			body:             `{"installed":{"client_id":"installed-id","client_secret":"installed-secret"}}`,
+			wantClientId:     "installed-id",
+			wantClientSecret: "installed-secret",
+			wantOk:           true,
+		},
+		{
+			name:             "web shape",
+			body:             `{"web":{"client_id":"web-id","client_secret":"web-secret"}}`,
+			wantClientId:     "web-id",
+			wantClientSecret: "web-secret",
+			wantOk:           true,
+		},
+		{
+			name:   "neither key present",
+			body:   `{"other":{"client_id":"x","client_secret":"y"}}`,
+			wantOk: false,
+		},
+		{
+			name:   "missing client_id",
+			body:   `{"installed":{"client_secret":"installed-secret"}}`,
+			wantOk: false,
+		},
+		{
+			name:   "not JSON",
+			body:   "FitBit",
+			wantOk: false,
+		},
+		{
+			name:   "unrelated JSON",
+			body:   `["a","b"]`,
+			wantOk: false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clientId, clientSecret, ok := parseClientSecretJSON([]byte(c.body))
+			if ok != c.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, c.wantOk)
+			}
+			if !c.wantOk {
+				return
+			}
+			if clientId != c.wantClientId || clientSecret != c.wantClientSecret {
+				t.Errorf("got (%q, %q), want (%q, %q)", clientId, clientSecret, c.wantClientId, c.wantClientSecret)
+			}
+		})
+	}
+}
+
+func TestLoadCredentialsDetectsSourceKind(t *testing.T) {
+	fileContents := `{"installed":{"client_id":"file-id","client_secret":"file-secret"}}`
+	tmpFile, err := ioutil.TempFile("", "client_secret*.json")
+	if err != nil {
+		t.Fatalf("unable to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.WriteString(fileContents); err != nil {
+		t.Fatalf("unable to write temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	inlineJSON := `{"web":{"client_id":"inline-id","client_secret":"inline-secret"}}`
+
+	cases := []struct {
+		name             string
+		source           string
+		wantClientId     string
+		wantClientSecret string
+	}{
+		{"file path", tmpFile.Name(), "file-id", "file-secret"},
+		{"inline JSON", inlineJSON, "inline-id", "inline-secret"},
+	}
+
+	input := &FitnessInput{}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clientId, clientSecret, scopes := input.loadCredentials(STRATEGY_GOOGLE, c.source)
+			if clientId != c.wantClientId || clientSecret != c.wantClientSecret {
+				t.Errorf("got (%q, %q), want (%q, %q)", clientId, clientSecret, c.wantClientId, c.wantClientSecret)
+			}
+			wantScopes := strategyScopes[STRATEGY_GOOGLE]
+			if len(scopes) != len(wantScopes) {
+				t.Errorf("got %d scopes, want %d", len(scopes), len(wantScopes))
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/AndyNortrup/GoSplunk"
+)
+
+// deviceAuthEndpoints maps a STRATEGY_* constant to the URL that issues
+// device and user codes under RFC 8628.
+var deviceAuthEndpoints = map[string]string{
+	STRATEGY_GOOGLE:    "https://oauth2.googleapis.com/device/code",
+	STRATEGY_FITBIT:    "https://api.fitbit.com/oauth2/device/code",
+	STRATEGY_MICROSOFT: "https://login.microsoftonline.com/common/oauth2/v2.0/devicecode",
+}
+
+// deviceCodeResponse is the RFC 8628 device authorization response.
+type deviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// deviceTokenError is the error body the token endpoint returns while a
+// device grant is still pending, denied, or expired.
+type deviceTokenError struct {
+	Error string `json:"error"`
+}
+
+// runDeviceAuthCommand implements the `device-auth` CLI subcommand used to
+// authorize a headless forwarder that has no browser available to complete
+// the normal redirect-based OAuth2 flow.
+func runDeviceAuthCommand(args []string) {
+	fs := flag.NewFlagSet("device-auth", flag.ExitOnError)
+	strategy := fs.String("strategy", "", "Fitness service to authorize: GoogleFitness, FitBit, or Microsoft")
+	clientId := fs.String("client-id", "", "OAuth2 client id for the service")
+	username := fs.String("username", "", "Account identifier this token belongs to (e.g. an email address). Lets more than one account be authorized for the same strategy")
+	sessionKey := fs.String("session-key", "", "Splunk session key used to write the resulting token to storage/passwords")
+	fs.Parse(args)
+
+	if *strategy == "" || *clientId == "" || *username == "" || *sessionKey == "" {
+		log.Fatalf("device-auth requires -strategy, -client-id, -username, and -session-key\n")
+	}
+
+	token, err := authorizeDevice(*strategy, *clientId)
+	if err != nil {
+		log.Fatalf("Device authorization failed: %v\n", err)
+	}
+
+	if err := persistDeviceToken(*sessionKey, *strategy, *username, token); err != nil {
+		log.Fatalf("Unable to persist authorized token: %v\n", err)
+	}
+
+	fmt.Println("Authorization complete.")
+}
+
+// authorizeDevice runs the RFC 8628 Device Authorization Grant for strategy:
+// it requests a device/user code pair, prints the verification URL and code
+// for the admin to visit, then polls the token endpoint at the provider's
+// requested interval until the grant is approved, denied, or expires.
+func authorizeDevice(strategy string, clientId string) (*oauth2.Token, error) {
+	endpoint, ok := strategyEndpoints[strategy]
+	if !ok {
+		return nil, errors.New("Unsupported strategy requested: " + strategy)
+	}
+	deviceURL, ok := deviceAuthEndpoints[strategy]
+	if !ok {
+		return nil, errors.New("No device authorization endpoint known for strategy: " + strategy)
+	}
+
+	resp, err := http.PostForm(deviceURL, url.Values{
+		"client_id": {clientId},
+		"scope":     {strings.Join(strategyScopes[strategy], " ")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var device deviceCodeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&device); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("To authorize %s, visit %s and enter code: %s\n", strategy, device.VerificationURI, device.UserCode)
+
+	interval := time.Duration(device.Interval) * time.Second
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		tokenResp, err := http.PostForm(endpoint.TokenURL, url.Values{
+			"client_id":   {clientId},
+			"device_code": {device.DeviceCode},
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(tokenResp.Body)
+		tokenResp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		var tok oauth2.Token
+		if err := json.Unmarshal(body, &tok); err == nil && tok.AccessToken != "" {
+			if tok.ExpiresIn > 0 {
+				tok.Expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+			}
+			return &tok, nil
+		}
+
+		var tokenErr deviceTokenError
+		if err := json.Unmarshal(body, &tokenErr); err != nil {
+			return nil, err
+		}
+
+		switch tokenErr.Error {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval *= 2
+		case "access_denied", "expired_token":
+			return nil, errors.New("device authorization " + tokenErr.Error)
+		default:
+			return nil, errors.New("device authorization failed: " + tokenErr.Error)
+		}
+	}
+
+	return nil, errors.New("device authorization timed out")
+}
+
+// persistDeviceToken marshals token into the same JSON shape getTokens
+// expects and writes it into storage/passwords under strategy's realm, named
+// for username, so the next modular input run picks it up alongside any
+// other account already authorized for the same strategy.
+func persistDeviceToken(sessionKey string, strategy string, username string, token *oauth2.Token) error {
+	tokenJSON, err := json.Marshal(tokenData{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		TokenType:    token.TokenType,
+		Expires:      token.Expiry.Format(tokenExpiryLayout),
+	})
+	if err != nil {
+		return err
+	}
+
+	return splunk.PostEntity(splunk.LocalSplunkMgmntURL,
+		[]string{"storage", "passwords"},
+		APP_NAME,
+		"nobody",
+		sessionKey,
+		url.Values{
+			"name":     {username},
+			"password": {string(tokenJSON)},
+			"realm":    {strategy},
+		})
+}
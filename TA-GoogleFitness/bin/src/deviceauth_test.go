@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// overrideDeviceAuthEndpoints points strategy's device-code and token
+// endpoints at test URLs for the duration of a test, returning a func that
+// deletes both entries again, which leaves the package maps as they were for
+// a strategy name not already in them.
+func overrideDeviceAuthEndpoints(strategy string, deviceURL string, tokenURL string) func() {
+	deviceAuthEndpoints[strategy] = deviceURL
+	strategyEndpoints[strategy] = oauth2.Endpoint{TokenURL: tokenURL}
+	return func() {
+		delete(deviceAuthEndpoints, strategy)
+		delete(strategyEndpoints, strategy)
+	}
+}
+
+func TestAuthorizeDeviceSucceedsAfterPending(t *testing.T) {
+	const strategy = "TestStrategyPending"
+	var polls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/device/code":
+			json.NewEncoder(w).Encode(deviceCodeResponse{
+				DeviceCode:      "device-code",
+				UserCode:        "USER-CODE",
+				VerificationURI: "https://example.com/device",
+				ExpiresIn:       30,
+				Interval:        1,
+			})
+		case "/token":
+			if atomic.AddInt32(&polls, 1) == 1 {
+				json.NewEncoder(w).Encode(deviceTokenError{Error: "authorization_pending"})
+				return
+			}
+			json.NewEncoder(w).Encode(oauth2.Token{AccessToken: "access-token", RefreshToken: "refresh-token", TokenType: "Bearer"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer overrideDeviceAuthEndpoints(strategy, server.URL+"/device/code", server.URL+"/token")()
+
+	token, err := authorizeDevice(strategy, "client-id")
+	if err != nil {
+		t.Fatalf("authorizeDevice returned an error: %v", err)
+	}
+	if token.AccessToken != "access-token" {
+		t.Errorf("expected access-token, got %q", token.AccessToken)
+	}
+	if got := atomic.LoadInt32(&polls); got < 2 {
+		t.Errorf("expected at least 2 polls (pending then success), got %d", got)
+	}
+}
+
+func TestAuthorizeDeviceSucceedsAfterSlowDown(t *testing.T) {
+	const strategy = "TestStrategySlowDown"
+	var polls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/device/code":
+			json.NewEncoder(w).Encode(deviceCodeResponse{
+				DeviceCode:      "device-code",
+				UserCode:        "USER-CODE",
+				VerificationURI: "https://example.com/device",
+				ExpiresIn:       30,
+				Interval:        1,
+			})
+		case "/token":
+			if atomic.AddInt32(&polls, 1) == 1 {
+				json.NewEncoder(w).Encode(deviceTokenError{Error: "slow_down"})
+				return
+			}
+			json.NewEncoder(w).Encode(oauth2.Token{AccessToken: "access-token", RefreshToken: "refresh-token", TokenType: "Bearer"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer overrideDeviceAuthEndpoints(strategy, server.URL+"/device/code", server.URL+"/token")()
+
+	token, err := authorizeDevice(strategy, "client-id")
+	if err != nil {
+		t.Fatalf("authorizeDevice returned an error: %v", err)
+	}
+	if token.AccessToken != "access-token" {
+		t.Errorf("expected access-token, got %q", token.AccessToken)
+	}
+}
+
+func TestAuthorizeDeviceTerminalErrors(t *testing.T) {
+	cases := []struct {
+		name        string
+		tokenError  string
+		wantErrText string
+	}{
+		{"access denied", "access_denied", "device authorization access_denied"},
+		{"expired token", "expired_token", "device authorization expired_token"},
+		{"unknown error", "invalid_client", "device authorization failed: invalid_client"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			strategy := "TestStrategyError-" + c.tokenError
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/device/code":
+					json.NewEncoder(w).Encode(deviceCodeResponse{
+						DeviceCode:      "device-code",
+						UserCode:        "USER-CODE",
+						VerificationURI: "https://example.com/device",
+						ExpiresIn:       30,
+						Interval:        1,
+					})
+				case "/token":
+					json.NewEncoder(w).Encode(deviceTokenError{Error: c.tokenError})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+			defer overrideDeviceAuthEndpoints(strategy, server.URL+"/device/code", server.URL+"/token")()
+
+			_, err := authorizeDevice(strategy, "client-id")
+			if err == nil {
+				t.Fatal("expected authorizeDevice to return an error")
+			}
+			if err.Error() != c.wantErrText {
+				t.Errorf("got error %q, want %q", err.Error(), c.wantErrText)
+			}
+		})
+	}
+}
+
+func TestAuthorizeDeviceUnsupportedStrategy(t *testing.T) {
+	if _, err := authorizeDevice("NotAStrategy", "client-id"); err == nil {
+		t.Error("expected an error for an unsupported strategy")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// main dispatches the modular input's command-line contract: Splunk invokes
+// this binary with --scheme to introspect the input, --validate-arguments to
+// check a proposed stanza, or with no arguments at all to stream events on
+// stdout. The device-auth subcommand is an operator-invoked helper, not part
+// of the modular input contract Splunk itself drives.
+func main() {
+	input := &FitnessInput{reader: os.Stdin, writer: os.Stdout}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "--scheme":
+			input.ReturnScheme()
+			return
+		case "--validate-arguments":
+			if ok, reason := input.ValidateScheme(); !ok {
+				fmt.Fprintln(os.Stderr, reason)
+				os.Exit(1)
+			}
+			return
+		case "device-auth":
+			runDeviceAuthCommand(os.Args[2:])
+			return
+		}
+	}
+
+	input.StreamEvents()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/microsoft"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// fitbitEndpoint is FitBit's OAuth2 endpoint.  golang.org/x/oauth2 doesn't
+// ship one, so it's declared the same way the package itself declares
+// google.Endpoint.
+var fitbitEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://www.fitbit.com/oauth2/authorize",
+	TokenURL: "https://api.fitbit.com/oauth2/token",
+}
+
+var googleEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+	TokenURL: "https://www.googleapis.com/oauth2/v3/token",
+}
+
+// strategyEndpoints maps a STRATEGY_* constant to the OAuth2 endpoint used to
+// exchange/refresh tokens for that service.
+var strategyEndpoints = map[string]oauth2.Endpoint{
+	STRATEGY_GOOGLE:    googleEndpoint,
+	STRATEGY_FITBIT:    fitbitEndpoint,
+	STRATEGY_MICROSOFT: microsoft.AzureADEndpoint("common"),
+}
+
+// strategyScopes holds the default OAuth2 scopes requested for each
+// strategy when an admin hasn't overridden them.
+var strategyScopes = map[string][]string{
+	STRATEGY_GOOGLE:    {"https://www.googleapis.com/auth/fitness.activity.read"},
+	STRATEGY_FITBIT:    {"activity", "heartrate", "sleep"},
+	STRATEGY_MICROSOFT: {"https://graph.microsoft.com/Health.Read"},
+}
+
+// tokenData is the JSON shape a token is stored as under storage/passwords:
+// getTokens decodes it, and persistDeviceToken/persistRefreshedToken encode
+// back to it.
+type tokenData struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	Expires      string `json:"expires_at"`
+}
+
+// tokenExpiryLayout is the layout persistDeviceToken/persistRefreshedToken
+// format an Expiry with and newToken parses it back with. It must not be
+// time.Time's default String() format: that appends a monotonic-clock
+// reading ("m=+1.234") whenever Expiry came from time.Now().Add(...), as it
+// always does here, and time.Parse can't make sense of that suffix.
+const tokenExpiryLayout = time.RFC3339Nano
+
+// newToken reconstructs an *oauth2.Token from the plain strings persisted in
+// storage/passwords.
+func newToken(refreshToken, accessToken, expires, tokenType string) *oauth2.Token {
+	expiry, err := time.Parse(tokenExpiryLayout, expires)
+	if err != nil {
+		expiry = time.Now()
+	}
+	return &oauth2.Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    tokenType,
+		Expiry:       expiry,
+	}
+}
+
+// getClient builds an *http.Client that authenticates with token and
+// transparently refreshes it against strategy's token endpoint as it
+// expires. Whenever the underlying TokenSource actually performs a refresh,
+// onRefresh is called with the token refreshed from and the token refreshed
+// to, so the caller can persist the new one and detect a stale write. Every
+// request the client makes is wrapped in an OpenTelemetry span via
+// otelhttp.NewTransport.
+func getClient(strategy string, token *oauth2.Token, clientId string, clientSecret string, scopes []string, onRefresh func(old *oauth2.Token, new *oauth2.Token)) *http.Client {
+	conf := &oauth2.Config{
+		ClientID:     clientId,
+		ClientSecret: clientSecret,
+		Endpoint:     strategyEndpoints[strategy],
+		Scopes:       scopes,
+	}
+	src := NotifyRefreshTokenSource(strategy, token, conf.TokenSource(context.Background(), token), onRefresh)
+	client := oauth2.NewClient(context.Background(), src)
+	client.Transport = otelhttp.NewTransport(client.Transport)
+	return client
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTokenExpiryRoundTrip(t *testing.T) {
+	// Expiry values in this codebase always come from time.Now().Add(...),
+	// which carries monotonic-clock state; format with the same layout
+	// persistRefreshedToken/persistDeviceToken use and make sure newToken
+	// parses it back rather than falling back to time.Now().
+	want := time.Now().Add(time.Hour)
+	persisted := want.Format(tokenExpiryLayout)
+
+	got := newToken("refresh-token", "access-token", persisted, "Bearer")
+
+	if !got.Expiry.Equal(want) {
+		t.Errorf("Expiry did not survive the round trip: want %v, got %v", want, got.Expiry)
+	}
+	if got.AccessToken != "access-token" || got.RefreshToken != "refresh-token" || got.TokenType != "Bearer" {
+		t.Errorf("unexpected token fields: %+v", got)
+	}
+}
+
+func TestNewTokenFallsBackOnUnparseableExpiry(t *testing.T) {
+	before := time.Now()
+	got := newToken("refresh-token", "access-token", "not-a-timestamp", "Bearer")
+	after := time.Now()
+
+	if got.Expiry.Before(before) || got.Expiry.After(after) {
+		t.Errorf("expected Expiry to fall back to the current time, got %v (want between %v and %v)", got.Expiry, before, after)
+	}
+}
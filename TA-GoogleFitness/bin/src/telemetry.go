@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// tracer is the package-wide OpenTelemetry tracer used by StreamEvents,
+// processToken, getReaderStrategy, and each FitnessReader. The OAuth2 HTTP
+// client's spans come from otelhttp.NewTransport, not from this tracer.
+var tracer = otel.Tracer(APP_NAME)
+
+// Prometheus collectors giving operators visibility into per-provider fetch
+// latency, event volume, and refresh failures that were previously only
+// visible as log.Fatalf crashes.
+var (
+	fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "fitness_fetch_duration_seconds",
+		Help: "Time spent fetching and emitting a single token's fitness data, by strategy.",
+	}, []string{"strategy"})
+
+	eventsEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fitness_events_emitted_total",
+		Help: "Number of fitness events emitted, by strategy.",
+	}, []string{"strategy"})
+
+	oauthRefreshTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fitness_oauth_refresh_total",
+		Help: "Number of OAuth2 token refreshes, by strategy and result.",
+	}, []string{"strategy", "result"})
+
+	checkpointLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fitness_checkpoint_lag_seconds",
+		Help: "Age, in seconds, of the checkpoint most recently written for a stanza.",
+	}, []string{"stanza"})
+)
+
+var metricsServerOnce sync.Once
+
+// startMetricsServer exposes the collectors above on :port/metrics. A
+// process hosts at most one metrics server, so later calls are no-ops.
+func startMetricsServer(port string) {
+	if port == "" {
+		return
+	}
+	metricsServerOnce.Do(func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		go func() {
+			if err := http.ListenAndServe(":"+port, mux); err != nil {
+				log.Printf("Unable to start Prometheus metrics server: %v\n", err)
+			}
+		}()
+	})
+}
+
+// initTracing points the global OpenTelemetry tracer provider at an OTLP
+// collector reachable at endpoint. If endpoint is empty, tracing is left
+// disabled. The returned func flushes and shuts the provider down.
+func initTracing(endpoint string) func(context.Context) error {
+	noop := func(context.Context) error { return nil }
+	if endpoint == "" {
+		return noop
+	}
+
+	exporter, err := otlptracegrpc.New(context.Background(),
+		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithInsecure())
+	if err != nil {
+		log.Printf("Unable to create OTLP exporter for %s: %v\n", endpoint, err)
+		return noop
+	}
+
+	res, err := resource.New(context.Background(), resource.WithAttributes(semconv.ServiceName(APP_NAME)))
+	if err != nil {
+		res = resource.Default()
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+
+	"github.com/AndyNortrup/GoSplunk"
+)
+
+// stanzaLocks serializes refreshed-token writes per (strategy, username)
+// within this process. It does nothing for two separate modular input
+// processes racing on the same entry -- that case is handled by the
+// compare-and-swap in persistRefreshedToken below -- but it still avoids
+// pointless duplicate writes from goroutines inside a single run.
+var stanzaLocks sync.Map
+
+func lockFor(key string) *sync.Mutex {
+	m, _ := stanzaLocks.LoadOrStore(key, &sync.Mutex{})
+	return m.(*sync.Mutex)
+}
+
+// notifyRefreshTokenSource wraps src so that whenever it returns a token
+// whose access token differs from the last one seen -- i.e. src actually
+// refreshed it -- onRefresh is called with the token that was refreshed
+// from and the one it was refreshed to. Every refresh attempt, successful
+// or not, is counted in fitness_oauth_refresh_total.
+type notifyRefreshTokenSource struct {
+	mu        sync.Mutex
+	strategy  string
+	src       oauth2.TokenSource
+	last      *oauth2.Token
+	onRefresh func(old *oauth2.Token, new *oauth2.Token)
+}
+
+func (s *notifyRefreshTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.src.Token()
+	if err != nil {
+		oauthRefreshTotal.WithLabelValues(s.strategy, "error").Inc()
+		return nil, err
+	}
+	if s.last == nil || t.AccessToken != s.last.AccessToken {
+		old := s.last
+		s.last = t
+		oauthRefreshTotal.WithLabelValues(s.strategy, "success").Inc()
+		s.onRefresh(old, t)
+	}
+	return t, nil
+}
+
+// NotifyRefreshTokenSource returns a TokenSource that calls onRefresh every
+// time src hands back a token that differs from the one most recently seen,
+// passing both the token that was refreshed from and the one refreshed to.
+func NotifyRefreshTokenSource(strategy string, token *oauth2.Token, src oauth2.TokenSource, onRefresh func(old *oauth2.Token, new *oauth2.Token)) oauth2.TokenSource {
+	return &notifyRefreshTokenSource{strategy: strategy, src: src, last: token, onRefresh: onRefresh}
+}
+
+// storedRefreshToken looks up the refresh token currently persisted for
+// strategy/username, the same way getTokens finds its entries. It's used by
+// persistRefreshedToken as the read half of a compare-and-swap so that two
+// modular input processes refreshing the same entry at once don't clobber
+// each other: whichever one's write loses the race finds a refresh token
+// that no longer matches what it refreshed from and backs off instead of
+// overwriting a newer one.
+func storedRefreshToken(sessionKey string, strategy string, username string) (string, bool) {
+	entities, err := splunk.GetEntities(splunk.LocalSplunkMgmntURL,
+		[]string{"storage", "passwords"},
+		APP_NAME,
+		"nobody",
+		sessionKey)
+	if err != nil {
+		log.Printf("Unable to read back storage/passwords entry for %s/%s: %v\n", strategy, username, err)
+		return "", false
+	}
+
+	for _, entry := range entities.Entries {
+		var tokenJSON, entryUsername, realm string
+		for _, key := range entry.Contents.Keys {
+			switch key.Name {
+			case "clear_password":
+				tokenJSON = key.Value
+			case "username":
+				entryUsername = key.Value
+			case "realm":
+				realm = key.Value
+			}
+		}
+		if realm != strategy || entryUsername != username {
+			continue
+		}
+
+		var stored tokenData
+		if err := json.Unmarshal([]byte(tokenJSON), &stored); err != nil {
+			log.Printf("Unable to decode storage/passwords entry for %s/%s: %v\n", strategy, username, err)
+			return "", false
+		}
+		return stored.RefreshToken, true
+	}
+
+	return "", false
+}
+
+// persistRefreshedToken writes token back to the storage/passwords entry it
+// came from (strategy + username). Before writing it re-reads the entry and
+// compares its refresh token against old, the token this refresh started
+// from: a mismatch means another modular input process already persisted a
+// newer refresh since, so this write is skipped rather than clobbering it.
+// The per-stanza lock only protects against the narrower case of two
+// goroutines in this same process racing on the same entry.
+func persistRefreshedToken(sessionKey string, strategy string, username string, old *oauth2.Token, token *oauth2.Token) {
+	lock := lockFor(strategy + ":" + username)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if current, ok := storedRefreshToken(sessionKey, strategy, username); ok && old != nil && current != old.RefreshToken {
+		log.Printf("Skipping refreshed token write for %s/%s: storage/passwords already holds a newer token\n", strategy, username)
+		return
+	}
+
+	tokenJSON, err := json.Marshal(tokenData{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		TokenType:    token.TokenType,
+		Expires:      token.Expiry.Format(tokenExpiryLayout),
+	})
+	if err != nil {
+		log.Printf("Unable to marshal refreshed token for %s/%s: %v\n", strategy, username, err)
+		return
+	}
+
+	err = splunk.UpdateEntity(splunk.LocalSplunkMgmntURL,
+		[]string{"storage", "passwords", strings.Join([]string{strategy, username, ""}, ":")},
+		APP_NAME,
+		"nobody",
+		sessionKey,
+		url.Values{"password": {string(tokenJSON)}})
+	if err != nil {
+		log.Printf("Unable to persist refreshed token for %s/%s: %v\n", strategy, username, err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// fixedTokenSource returns tokens from a fixed queue, one per call, and the
+// error (if any) after the queue is exhausted.
+type fixedTokenSource struct {
+	tokens []*oauth2.Token
+	err    error
+	calls  int
+}
+
+func (f *fixedTokenSource) Token() (*oauth2.Token, error) {
+	if f.calls < len(f.tokens) {
+		t := f.tokens[f.calls]
+		f.calls++
+		return t, nil
+	}
+	return nil, f.err
+}
+
+func TestNotifyRefreshTokenSourceCallsOnRefreshOnlyWhenTokenChanges(t *testing.T) {
+	initial := &oauth2.Token{AccessToken: "token-1"}
+	refreshed := &oauth2.Token{AccessToken: "token-2"}
+
+	src := &fixedTokenSource{tokens: []*oauth2.Token{initial, initial, refreshed, refreshed}}
+
+	var refreshCalls []struct{ old, new *oauth2.Token }
+	onRefresh := func(old *oauth2.Token, new *oauth2.Token) {
+		refreshCalls = append(refreshCalls, struct{ old, new *oauth2.Token }{old, new})
+	}
+
+	notify := NotifyRefreshTokenSource(STRATEGY_GOOGLE, initial, src, onRefresh)
+
+	// First Token() call returns the same access token as the source was
+	// seeded with -- not a refresh, onRefresh should not fire.
+	if _, err := notify.Token(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(refreshCalls) != 0 {
+		t.Fatalf("expected no onRefresh calls yet, got %d", len(refreshCalls))
+	}
+
+	// Second call still returns token-1, still not a refresh.
+	if _, err := notify.Token(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(refreshCalls) != 0 {
+		t.Fatalf("expected no onRefresh calls yet, got %d", len(refreshCalls))
+	}
+
+	// Third call returns token-2: this is a genuine refresh.
+	if _, err := notify.Token(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(refreshCalls) != 1 {
+		t.Fatalf("expected exactly 1 onRefresh call, got %d", len(refreshCalls))
+	}
+	if refreshCalls[0].old.AccessToken != "token-1" || refreshCalls[0].new.AccessToken != "token-2" {
+		t.Errorf("got old=%q new=%q, want old=token-1 new=token-2", refreshCalls[0].old.AccessToken, refreshCalls[0].new.AccessToken)
+	}
+
+	// Fourth call still returns token-2: no further refresh.
+	if _, err := notify.Token(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(refreshCalls) != 1 {
+		t.Errorf("expected still exactly 1 onRefresh call, got %d", len(refreshCalls))
+	}
+}
+
+func TestNotifyRefreshTokenSourceDoesNotNotifyOnError(t *testing.T) {
+	initial := &oauth2.Token{AccessToken: "token-1"}
+	src := &fixedTokenSource{err: errors.New("token endpoint unavailable")}
+
+	called := false
+	notify := NotifyRefreshTokenSource(STRATEGY_FITBIT, initial, src, func(old, new *oauth2.Token) {
+		called = true
+	})
+
+	if _, err := notify.Token(); err == nil {
+		t.Fatal("expected an error from Token()")
+	}
+	if called {
+		t.Error("onRefresh should not be called when the underlying source errors")
+	}
+}